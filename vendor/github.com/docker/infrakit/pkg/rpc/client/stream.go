@@ -0,0 +1,70 @@
+package client
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/websocket"
+)
+
+// StreamReader consumes the incremental messages sent by a plugin's streaming RPC method, opened with Stream.
+// Callers range over Recv instead of polling a unary method for progress.
+type StreamReader struct {
+	conn *websocket.Conn
+}
+
+// encodeStreamService turns service into a single mux path segment safe to embed in the dial URL. service
+// is Name/Version-shaped data, so embedding it raw would split across what the server's {service} route
+// var expects to be one segment; base64 URL encoding sidesteps that (and spaces/other unsafe characters)
+// since its alphabet never contains "/". Must match the server's identical encodeStreamService.
+func encodeStreamService(service string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(service))
+}
+
+// Stream opens a streaming RPC call against the plugin listening at addr (host:port, no scheme), for the
+// given service and method, and sends request as the initial message. service is the same string a plugin's
+// ImplementedInterface renders to, as seen during the handshake.
+func Stream(addr, service, method string, request interface{}) (*StreamReader, error) {
+	return stream(websocket.DefaultDialer, "ws", addr, service, method, request)
+}
+
+// StreamWithTLS is the same as Stream, except it dials over wss:// using the given TLSConfig, presenting a
+// client certificate when one is configured. It is the streaming counterpart to DialWithTLS, for plugins
+// started with server.StartListenerWithTLS.
+func StreamWithTLS(addr, service, method string, request interface{}, config *TLSConfig) (*StreamReader, error) {
+	tlsConfig, err := newTLSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := *websocket.DefaultDialer
+	dialer.TLSClientConfig = tlsConfig
+	return stream(&dialer, "wss", addr, service, method, request)
+}
+
+func stream(dialer *websocket.Dialer, scheme, addr, service, method string, request interface{}) (*StreamReader, error) {
+	dialURL := fmt.Sprintf("%s://%s/stream/%s/%s", scheme, addr, encodeStreamService(service), url.PathEscape(method))
+	conn, _, err := dialer.Dial(dialURL, http.Header{})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.WriteJSON(request); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &StreamReader{conn: conn}, nil
+}
+
+// Recv blocks until the next message arrives and decodes it into message.
+func (s *StreamReader) Recv(message interface{}) error {
+	return s.conn.ReadJSON(message)
+}
+
+// Close terminates the streaming call.
+func (s *StreamReader) Close() error {
+	return s.conn.Close()
+}
@@ -0,0 +1,29 @@
+package client
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEncodeStreamService(t *testing.T) {
+	cases := []struct {
+		name    string
+		service string
+	}{
+		{name: "name/version shaped spec", service: "Instance/0.6.0"},
+		{name: "contains a space", service: "My Plugin/1.0"},
+		{name: "empty", service: ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			token := encodeStreamService(c.service)
+			if strings.ContainsAny(token, "/ ") {
+				t.Errorf("encodeStreamService(%q) = %q, contains a character unsafe for a single URL path segment", c.service, token)
+			}
+			if token != encodeStreamService(c.service) {
+				t.Errorf("encodeStreamService(%q) is not deterministic", c.service)
+			}
+		})
+	}
+}
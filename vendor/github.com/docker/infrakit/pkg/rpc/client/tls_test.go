@@ -0,0 +1,102 @@
+package client
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestNewTLSConfigWithCABundle(t *testing.T) {
+	certFile, cleanup := writeTestCert(t)
+	defer cleanup()
+
+	config, err := newTLSConfig(&TLSConfig{CAFile: certFile, MinVersion: tls.VersionTLS12})
+	if err != nil {
+		t.Fatalf("newTLSConfig: %v", err)
+	}
+	if config.RootCAs == nil {
+		t.Error("expected RootCAs to be populated from CAFile")
+	}
+	if config.MinVersion != tls.VersionTLS12 {
+		t.Errorf("MinVersion = %d, want %d", config.MinVersion, tls.VersionTLS12)
+	}
+}
+
+func TestNewTLSConfigWithoutClientCert(t *testing.T) {
+	config, err := newTLSConfig(&TLSConfig{})
+	if err != nil {
+		t.Fatalf("newTLSConfig: %v", err)
+	}
+	if len(config.Certificates) != 0 {
+		t.Errorf("expected no client certificate when CertFile/KeyFile are unset, got %d", len(config.Certificates))
+	}
+}
+
+func TestNewTLSConfigBadCABundle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "infrakit-tls-test")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	badCA := dir + "/ca.pem"
+	if err := ioutil.WriteFile(badCA, []byte("not a certificate"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	if _, err := newTLSConfig(&TLSConfig{CAFile: badCA}); err == nil {
+		t.Error("expected an error for a CA bundle with no valid certificates")
+	}
+}
+
+// writeTestCert generates a throwaway self-signed certificate, writes it to a temp dir as a PEM file, and
+// returns its path and a cleanup func -- so these tests don't depend on fixtures checked into the repo or
+// external tooling like openssl.
+func writeTestCert(t *testing.T) (certFile string, cleanup func()) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{Organization: []string{"infrakit test"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "infrakit-tls-test")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+
+	certFile = dir + "/cert.pem"
+	certOut, err := os.Create(certFile)
+	if err != nil {
+		t.Fatalf("create cert file: %v", err)
+	}
+	if err := pem.Encode(certOut, &pem.Block{Type: "CERTIFICATE", Bytes: der}); err != nil {
+		t.Fatalf("encode cert: %v", err)
+	}
+	certOut.Close()
+
+	return certFile, func() { os.RemoveAll(dir) }
+}
@@ -0,0 +1,194 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// LogOptions configures the structured access log emitted for each RPC request. It replaces the ad-hoc
+// loggingHandler, which dumped full requests and responses at debug level and could leak secrets such as
+// DigitalOcean API tokens into plugin logs.
+type LogOptions struct {
+	// Format selects the record encoding: "text" (default), "json", or "combined" (Apache-style line up to the
+	// response size; the referer and user-agent fields of the combined log format are not written).
+	Format string
+	// SampleRate keeps roughly this fraction of requests, in (0, 1]. Zero means 1 (log every request).
+	SampleRate float64
+	// MaxBodySize caps how many bytes of the request body are inspected for redaction and service/method
+	// parsing. Zero means no cap. The response body is never inspected, only its length is recorded.
+	MaxBodySize int
+	// Redact lists top-level JSON field names in the request body whose values are replaced with "REDACTED"
+	// before the body is inspected to parse the RPC service/method, e.g. "access_token".
+	Redact []string
+}
+
+func (o LogOptions) sampleRate() float64 {
+	if o.SampleRate <= 0 {
+		return 1
+	}
+	return o.SampleRate
+}
+
+func (o LogOptions) cap(body []byte) []byte {
+	if o.MaxBodySize > 0 && len(body) > o.MaxBodySize {
+		return body[:o.MaxBodySize]
+	}
+	return body
+}
+
+func (o LogOptions) redactBody(body []byte) []byte {
+	if len(o.Redact) == 0 || len(body) == 0 {
+		return body
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return body
+	}
+
+	redactedAny := false
+	for _, name := range o.Redact {
+		if _, ok := fields[name]; ok {
+			fields[name] = json.RawMessage(`"REDACTED"`)
+			redactedAny = true
+		}
+	}
+	if !redactedAny {
+		return body
+	}
+
+	out, err := json.Marshal(fields)
+	if err != nil {
+		return body
+	}
+	return out
+}
+
+// accessLogRecord is one structured record per RPC request.
+type accessLogRecord struct {
+	Method     string `json:"method"`
+	Service    string `json:"service"`
+	RPCMethod  string `json:"rpc_method"`
+	Status     int    `json:"status"`
+	LatencyMS  int64  `json:"latency_ms"`
+	BytesIn    int    `json:"bytes_in"`
+	BytesOut   int    `json:"bytes_out"`
+	RemoteAddr string `json:"remote_addr"`
+}
+
+func (r accessLogRecord) text() string {
+	return fmt.Sprintf(
+		"%s %s - %s.%s %d %dms in=%dB out=%dB",
+		r.RemoteAddr, r.Method, r.Service, r.RPCMethod, r.Status, r.LatencyMS, r.BytesIn, r.BytesOut,
+	)
+}
+
+func (r accessLogRecord) combined() string {
+	// Apache combined log format layout, with the JSON-RPC Service.Method standing in for the request line.
+	// It ends at the response size: the referer and user-agent fields are not written.
+	return fmt.Sprintf(
+		`%s - - [%s] "%s %s.%s" %d %d`,
+		r.RemoteAddr, time.Now().Format("02/Jan/2006:15:04:05 -0700"), r.Method, r.Service, r.RPCMethod,
+		r.Status, r.BytesOut,
+	)
+}
+
+// accessLogHandler wraps the RPC handler, emitting one structured accessLogRecord per request instead of
+// dumping the full request/response at debug level.
+type accessLogHandler struct {
+	handler http.Handler
+	options LogOptions
+	sample  func() bool
+}
+
+func newAccessLogHandler(handler http.Handler, options LogOptions) accessLogHandler {
+	return accessLogHandler{handler: handler, options: options, sample: sampler(options.sampleRate())}
+}
+
+// sampler returns a func that reports true for roughly rate of its calls, deterministically (every Nth call)
+// rather than via math/rand, so access logging stays reproducible in tests. A rate of zero or less, like a
+// rate of 1 or more, reports true for every call.
+func sampler(rate float64) func() bool {
+	if rate <= 0 || rate >= 1 {
+		return func() bool { return true }
+	}
+	every := int64(1 / rate)
+	if every < 1 {
+		every = 1
+	}
+	var calls int64
+	return func() bool {
+		return atomic.AddInt64(&calls, 1)%every == 0
+	}
+}
+
+// copyResponseHeader copies every header recorded on an httptest.ResponseRecorder onto w, so that handlers
+// which buffer the response to inspect its status/body first (accessLogHandler, metricsHandler) don't
+// silently drop headers the wrapped handler set, e.g. the JSON-RPC codec's Content-Type.
+func copyResponseHeader(w http.ResponseWriter, recorder *httptest.ResponseRecorder) {
+	for key, values := range recorder.Header() {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+}
+
+func (h accessLogHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !h.sample() {
+		h.handler.ServeHTTP(w, req)
+		return
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err == nil {
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	bytesIn := len(body)
+	body = h.options.cap(body)
+
+	// redactBody only feeds the log record below; req itself is left untouched so the downstream RPC
+	// handler still sees the real credentials it needs to authenticate the call.
+	service, rpcMethod := serviceAndMethod(h.options.redactBody(body))
+	req = withServiceAndMethod(req, service, rpcMethod)
+
+	recorder := httptest.NewRecorder()
+	start := time.Now()
+	h.handler.ServeHTTP(recorder, req)
+
+	record := accessLogRecord{
+		Method:     req.Method,
+		Service:    service,
+		RPCMethod:  rpcMethod,
+		Status:     recorder.Code,
+		LatencyMS:  time.Since(start).Nanoseconds() / int64(time.Millisecond),
+		BytesIn:    bytesIn,
+		BytesOut:   recorder.Body.Len(),
+		RemoteAddr: req.RemoteAddr,
+	}
+
+	switch strings.ToLower(h.options.Format) {
+	case "json":
+		if encoded, err := json.Marshal(record); err == nil {
+			log.Infoln(string(encoded))
+		} else {
+			log.Error(err)
+		}
+	case "combined":
+		log.Infoln(record.combined())
+	default:
+		log.Infoln(record.text())
+	}
+
+	copyResponseHeader(w, recorder)
+	w.WriteHeader(recorder.Code)
+	recorder.Body.WriteTo(w)
+}
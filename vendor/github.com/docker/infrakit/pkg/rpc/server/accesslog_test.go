@@ -0,0 +1,52 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSampler(t *testing.T) {
+	cases := []struct {
+		name  string
+		rate  float64
+		calls int
+		want  int
+	}{
+		{name: "zero rate logs every call", rate: 0, calls: 5, want: 5},
+		{name: "rate of 1 logs every call", rate: 1, calls: 5, want: 5},
+		{name: "rate of half logs every other call", rate: 0.5, calls: 6, want: 3},
+		{name: "rate of a quarter logs every fourth call", rate: 0.25, calls: 8, want: 2},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			sample := sampler(c.rate)
+			got := 0
+			for i := 0; i < c.calls; i++ {
+				if sample() {
+					got++
+				}
+			}
+			if got != c.want {
+				t.Errorf("sampled %d of %d calls, want %d", got, c.calls, c.want)
+			}
+		})
+	}
+}
+
+func TestCopyResponseHeader(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	recorder.Header().Set("Content-Type", "application/json")
+	recorder.Header().Add("X-Multi", "a")
+	recorder.Header().Add("X-Multi", "b")
+
+	w := httptest.NewRecorder()
+	copyResponseHeader(w, recorder)
+
+	if got := w.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+	if got := w.Header()["X-Multi"]; len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Errorf("X-Multi = %v, want [a b]", got)
+	}
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// urlMetrics is where the private registry built by newMetrics is exposed in Prometheus text format.
+const urlMetrics = "/metrics"
+
+// metrics holds the RED-style (rate, errors, duration) collectors used to instrument the RPC router and the
+// event broker, registered against a private prometheus.Registry so that multiple plugins sharing a process
+// don't clash over collector names.
+type metrics struct {
+	registry         *prometheus.Registry
+	requestsTotal    *prometheus.CounterVec
+	requestDuration  *prometheus.HistogramVec
+	requestsInFlight *prometheus.GaugeVec
+	subscribers      *prometheus.GaugeVec
+	eventsTotal      *prometheus.CounterVec
+}
+
+func newMetrics() *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		requestsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "infrakit_rpc_requests_total",
+			Help: "Total number of RPC requests handled, by service, method and response status.",
+		}, []string{"service", "method", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "infrakit_rpc_request_duration_seconds",
+			Help:    "RPC request latency in seconds, by service and method.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"service", "method"}),
+		requestsInFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "infrakit_rpc_requests_in_flight",
+			Help: "Number of RPC requests currently being handled, by service and method.",
+		}, []string{"service", "method"}),
+		subscribers: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "infrakit_event_subscribers",
+			Help: "Number of active event broker subscribers, by topic.",
+		}, []string{"topic"}),
+		eventsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "infrakit_events_published_total",
+			Help: "Total number of events published, by topic.",
+		}, []string{"topic"}),
+	}
+	m.registry.MustRegister(
+		m.requestsTotal, m.requestDuration, m.requestsInFlight, m.subscribers, m.eventsTotal,
+	)
+	return m
+}
+
+// rpcEnvelope is the subset of the gorilla/rpc json2 request body we need in order to attribute metrics to
+// Service.Method.
+type rpcEnvelope struct {
+	Method string `json:"method"`
+}
+
+func serviceAndMethod(body []byte) (service, method string) {
+	service, method = "unknown", "unknown"
+
+	var envelope rpcEnvelope
+	if err := json.Unmarshal(body, &envelope); err != nil || envelope.Method == "" {
+		return
+	}
+
+	parts := strings.SplitN(envelope.Method, ".", 2)
+	service = parts[0]
+	if len(parts) > 1 {
+		method = parts[1]
+	}
+	return
+}
+
+// registeredMethods enumerates, for each target, the gorilla/rpc service name server.RegisterService derives
+// for it (its Go type name) and the exported methods that service dispatches, so metricsHandler can bound
+// its label cardinality to names a caller could legitimately invoke instead of whatever it puts in the
+// JSON-RPC envelope.
+func registeredMethods(targets []VersionedInterface) map[string]map[string]bool {
+	registered := map[string]map[string]bool{}
+	for _, t := range targets {
+		rt := reflect.TypeOf(t)
+		serviceName := reflect.Indirect(reflect.ValueOf(t)).Type().Name()
+
+		methods := registered[serviceName]
+		if methods == nil {
+			methods = map[string]bool{}
+			registered[serviceName] = methods
+		}
+		for i := 0; i < rt.NumMethod(); i++ {
+			methods[rt.Method(i).Name] = true
+		}
+	}
+	return registered
+}
+
+// validateServiceMethod checks service/method -- as parsed from a client-supplied JSON-RPC envelope --
+// against registered, falling back to "unknown" for either half that doesn't match something actually
+// reachable. Without this, a caller could grow the requestsTotal/requestDuration/requestsInFlight vectors
+// without bound simply by sending a unique method string per request.
+func validateServiceMethod(registered map[string]map[string]bool, service, method string) (string, string) {
+	methods, ok := registered[service]
+	if !ok {
+		return "unknown", "unknown"
+	}
+	if !methods[method] {
+		return service, "unknown"
+	}
+	return service, method
+}
+
+type serviceMethodKey struct{}
+
+// withServiceAndMethod attaches an already-parsed service/method pair to req's context, so a handler further
+// down the chain (e.g. metricsHandler, wrapped by accessLogHandler) doesn't have to re-read and re-parse the
+// JSON-RPC envelope that accessLogHandler already parsed.
+func withServiceAndMethod(req *http.Request, service, method string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), serviceMethodKey{}, [2]string{service, method}))
+}
+
+func serviceAndMethodFromContext(req *http.Request) (service, method string, ok bool) {
+	pair, ok := req.Context().Value(serviceMethodKey{}).([2]string)
+	if !ok {
+		return "", "", false
+	}
+	return pair[0], pair[1], true
+}
+
+// metricsHandler wraps the RPC handler, parsing the JSON-RPC envelope of each request to attribute request
+// counts, latency and in-flight gauges to Service.Method. Service/method are validated against registered
+// before use as label values, so an unbounded stream of made-up method names can't grow the collectors.
+type metricsHandler struct {
+	handler    http.Handler
+	metrics    *metrics
+	registered map[string]map[string]bool
+}
+
+func (h metricsHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	service, method, ok := serviceAndMethodFromContext(req)
+	if !ok {
+		body, err := ioutil.ReadAll(req.Body)
+		if err == nil {
+			req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+		service, method = serviceAndMethod(body)
+	}
+	service, method = validateServiceMethod(h.registered, service, method)
+
+	h.metrics.requestsInFlight.WithLabelValues(service, method).Inc()
+	defer h.metrics.requestsInFlight.WithLabelValues(service, method).Dec()
+
+	recorder := httptest.NewRecorder()
+	start := time.Now()
+	h.handler.ServeHTTP(recorder, req)
+
+	h.metrics.requestDuration.WithLabelValues(service, method).Observe(time.Since(start).Seconds())
+	h.metrics.requestsTotal.WithLabelValues(service, method, strconv.Itoa(recorder.Code)).Inc()
+
+	copyResponseHeader(w, recorder)
+	w.WriteHeader(recorder.Code)
+	recorder.Body.WriteTo(w)
+}
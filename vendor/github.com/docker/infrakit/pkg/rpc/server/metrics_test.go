@@ -0,0 +1,57 @@
+package server
+
+import (
+	"testing"
+)
+
+func TestServiceAndMethod(t *testing.T) {
+	cases := []struct {
+		name        string
+		body        []byte
+		wantService string
+		wantMethod  string
+	}{
+		{name: "well formed envelope", body: []byte(`{"method":"Instance.Provision"}`), wantService: "Instance", wantMethod: "Provision"},
+		{name: "missing dot falls back to unknown method", body: []byte(`{"method":"Instance"}`), wantService: "Instance", wantMethod: "unknown"},
+		{name: "empty method", body: []byte(`{"method":""}`), wantService: "unknown", wantMethod: "unknown"},
+		{name: "unparseable body", body: []byte(`not json`), wantService: "unknown", wantMethod: "unknown"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			service, method := serviceAndMethod(c.body)
+			if service != c.wantService || method != c.wantMethod {
+				t.Errorf("serviceAndMethod(%s) = (%q, %q), want (%q, %q)",
+					c.body, service, method, c.wantService, c.wantMethod)
+			}
+		})
+	}
+}
+
+func TestValidateServiceMethod(t *testing.T) {
+	registered := map[string]map[string]bool{
+		"Instance": {"Provision": true, "Destroy": true},
+	}
+
+	cases := []struct {
+		name        string
+		service     string
+		method      string
+		wantService string
+		wantMethod  string
+	}{
+		{name: "registered service and method", service: "Instance", method: "Provision", wantService: "Instance", wantMethod: "Provision"},
+		{name: "registered service, unknown method", service: "Instance", method: "MadeUp", wantService: "Instance", wantMethod: "unknown"},
+		{name: "unregistered service", service: "MadeUp", method: "Provision", wantService: "unknown", wantMethod: "unknown"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			service, method := validateServiceMethod(registered, c.service, c.method)
+			if service != c.wantService || method != c.wantMethod {
+				t.Errorf("validateServiceMethod(%q, %q) = (%q, %q), want (%q, %q)",
+					c.service, c.method, service, method, c.wantService, c.wantMethod)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// envListenFDs, when set in a plugin process's environment, tells it that fd 3 is an already-bound listening
+// socket handed down by a parent that called Reload -- the same LISTEN_FDS convention systemd socket
+// activation uses, so an upgraded binary can take over a TCP port or unix socket without ever unbinding it.
+const envListenFDs = "INFRAKIT_LISTEN_FDS"
+
+// inheritedOrListen returns the listener inherited via envListenFDs, if any, otherwise binds a new one.
+func inheritedOrListen(network, addr string) (net.Listener, error) {
+	if l, err := inheritedListener(); err != nil || l != nil {
+		return l, err
+	}
+	return net.Listen(network, addr)
+}
+
+func inheritedListener() (net.Listener, error) {
+	count, err := strconv.Atoi(os.Getenv(envListenFDs))
+	if err != nil || count < 1 {
+		return nil, nil
+	}
+	file := os.NewFile(uintptr(3), "infrakit-listener")
+	return net.FileListener(file)
+}
+
+// StartListenerAtPathWithReload is the same as StartListenerAtPath, except SIGHUP (or an explicit call to
+// the returned Stoppable's Reload) re-execs the running binary, handing it the already-bound listening
+// socket. Existing connections keep draining through this process's graceful.Server while the new process
+// accepts new ones -- the pattern long-running HTTP daemons use for zero-downtime upgrades. This is
+// particularly valuable for the event broker, whose SSE subscribers would otherwise die on every restart.
+func StartListenerAtPathWithReload(listen []string, discoverPath string, opt ListenerOptions,
+	receiver VersionedInterface, more ...VersionedInterface) (Stoppable, error) {
+
+	stoppable, err := startAtPath(listen, discoverPath, nil, opt, receiver, more...)
+	if err != nil {
+		return nil, err
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	go func() {
+		for range sig {
+			if err := stoppable.Reload(); err != nil {
+				log.Error(err)
+			}
+		}
+	}()
+
+	return stoppable, nil
+}
+
+// Reload re-execs the running binary, passing the listening socket's file descriptor as the new process's
+// fd 3 and setting envListenFDs, then drains this server's in-flight connections while the new process takes over accepting
+// connections on the inherited socket. It hands off fdListener rather than listener: when the server was
+// started with StartListenerWithTLS, listener is a tls.Listener wrapping fdListener, and tls.Listener doesn't
+// support file descriptor passing.
+func (s *stoppableServer) Reload() error {
+	listenerFile, err := fileFromListener(s.fdListener)
+	if err != nil {
+		return err
+	}
+	defer listenerFile.Close()
+
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	proc, err := os.StartProcess(executable, os.Args, &os.ProcAttr{
+		Env:   append(os.Environ(), fmt.Sprintf("%s=1", envListenFDs)),
+		Files: []*os.File{os.Stdin, os.Stdout, os.Stderr, listenerFile},
+	})
+	if err != nil {
+		return err
+	}
+	// The successor has the socket and will rewrite the discovery file for itself, so this process's own
+	// drain-then-exit must not remove it out from under that successor.
+	atomic.StoreInt32(&s.reloaded, 1)
+	// Likewise, closing a unix listener would unlink its socket path, which now belongs to the successor.
+	if ul, ok := s.fdListener.(*net.UnixListener); ok {
+		ul.SetUnlinkOnClose(false)
+	}
+	log.Infof("Reload: handed listener off to new process %d", proc.Pid)
+
+	s.Stop()
+	return nil
+}
+
+// fileFromListener duplicates the OS file descriptor backing l, so it can be inherited by a child process
+// without being closed out from under this process's still-draining connections.
+func fileFromListener(l net.Listener) (*os.File, error) {
+	type filer interface {
+		File() (*os.File, error)
+	}
+	f, ok := l.(filer)
+	if !ok {
+		return nil, fmt.Errorf("listener %T does not support file descriptor passing", l)
+	}
+	return f.File()
+}
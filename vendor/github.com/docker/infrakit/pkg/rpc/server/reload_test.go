@@ -0,0 +1,65 @@
+package server
+
+import (
+	"net"
+	"os"
+	"testing"
+)
+
+func TestInheritedOrListenWithoutEnv(t *testing.T) {
+	os.Unsetenv(envListenFDs)
+
+	l, err := inheritedOrListen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("inheritedOrListen: %v", err)
+	}
+	defer l.Close()
+
+	if _, ok := l.(*net.TCPListener); !ok {
+		t.Errorf("expected a freshly bound *net.TCPListener when %s is unset, got %T", envListenFDs, l)
+	}
+}
+
+func TestInheritedListenerWithoutEnv(t *testing.T) {
+	os.Unsetenv(envListenFDs)
+
+	l, err := inheritedListener()
+	if err != nil {
+		t.Fatalf("inheritedListener: %v", err)
+	}
+	if l != nil {
+		t.Errorf("expected no inherited listener when %s is unset, got %v", envListenFDs, l)
+	}
+}
+
+type fileNotSupportedListener struct {
+	net.Listener
+}
+
+func TestFileFromListenerSupported(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	defer l.Close()
+
+	f, err := fileFromListener(l)
+	if err != nil {
+		t.Fatalf("fileFromListener: %v", err)
+	}
+	f.Close()
+}
+
+func TestFileFromListenerUnsupported(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	defer l.Close()
+
+	// Wrapping in a type that only embeds net.Listener, the way tls.Listener does, hides the underlying
+	// File() method and should surface as an explicit error rather than a panic.
+	if _, err := fileFromListener(fileNotSupportedListener{Listener: l}); err == nil {
+		t.Error("expected an error for a listener that doesn't support file descriptor passing")
+	}
+}
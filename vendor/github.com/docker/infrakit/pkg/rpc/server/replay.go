@@ -0,0 +1,115 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/docker/infrakit/pkg/spi/event"
+)
+
+// defaultEventBufferSize is the number of events kept per topic for targets that don't implement
+// EventBufferer.
+const defaultEventBufferSize = 100
+
+// EventBufferer lets a plugin configure the size of its per-topic event replay ring buffer. Targets that
+// don't implement this get defaultEventBufferSize.
+type EventBufferer interface {
+	EventBufferSize() int
+}
+
+type bufferedEvent struct {
+	seq   uint64
+	event *event.Event
+}
+
+// eventReplay is a bounded, per-topic ring buffer of recently published events, keyed by topic, with a
+// monotonic sequence number assigned at publish time so subscribers can resume from a cursor after a
+// disconnect instead of missing whatever was published while they were gone.
+type eventReplay struct {
+	mu          sync.Mutex
+	seq         uint64
+	buffers     map[string][]bufferedEvent
+	bufferSizes map[string]int
+}
+
+func newEventReplay() *eventReplay {
+	return &eventReplay{
+		buffers:     map[string][]bufferedEvent{},
+		bufferSizes: map[string]int{},
+	}
+}
+
+// append records evt under topic, trimming the topic's buffer down to size (or defaultEventBufferSize if
+// size is zero), and returns the sequence number assigned to evt.
+func (r *eventReplay) append(topic string, size int, evt *event.Event) uint64 {
+	if size <= 0 {
+		size = defaultEventBufferSize
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.seq++
+	seq := r.seq
+
+	buffered := append(r.buffers[topic], bufferedEvent{seq: seq, event: evt})
+	if len(buffered) > size {
+		buffered = buffered[len(buffered)-size:]
+	}
+	r.buffers[topic] = buffered
+
+	return seq
+}
+
+// since returns the events buffered for topic with a sequence number greater than cursor, oldest first.
+func (r *eventReplay) since(topic string, cursor uint64) []bufferedEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var out []bufferedEvent
+	for _, e := range r.buffers[topic] {
+		if e.seq > cursor {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// cursorFromRequest reads the resume-from cursor a reconnecting subscriber sent, honoring the standard SSE
+// Last-Event-ID header and falling back to a ?since= query parameter. present is false when the subscriber
+// sent neither, which must be distinguished from an explicit cursor of 0: every buffered event has seq > 0,
+// so treating "no cursor" as "cursor 0" would replay a first-time subscriber the entire backlog.
+func cursorFromRequest(req *http.Request) (cursor uint64, present bool) {
+	id := req.Header.Get("Last-Event-ID")
+	if id == "" {
+		id = req.URL.Query().Get("since")
+	}
+	if id == "" {
+		return 0, false
+	}
+	cursor, err := strconv.ParseUint(id, 10, 64)
+	return cursor, err == nil
+}
+
+// writeReplay emits buffered as SSE records on w before the caller hands off to live streaming, so a
+// reconnecting subscriber sees everything it missed without the broker dropping it on the floor.
+func writeReplay(w http.ResponseWriter, topic string, buffered []bufferedEvent) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	flusher, canFlush := w.(http.Flusher)
+
+	for _, b := range buffered {
+		data, err := json.Marshal(b.event)
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", b.seq, topic, data)
+		if canFlush {
+			flusher.Flush()
+		}
+	}
+}
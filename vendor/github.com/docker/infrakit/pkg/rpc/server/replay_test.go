@@ -0,0 +1,96 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCursorFromRequest(t *testing.T) {
+	cases := []struct {
+		name        string
+		lastEventID string
+		since       string
+		wantCursor  uint64
+		wantPresent bool
+	}{
+		{name: "no cursor supplied", wantCursor: 0, wantPresent: false},
+		{name: "last-event-id header", lastEventID: "42", wantCursor: 42, wantPresent: true},
+		{name: "since query param", since: "7", wantCursor: 7, wantPresent: true},
+		{name: "header takes precedence over query", lastEventID: "5", since: "9", wantCursor: 5, wantPresent: true},
+		{name: "explicit cursor of zero", lastEventID: "0", wantCursor: 0, wantPresent: true},
+		{name: "unparseable cursor", lastEventID: "not-a-number", wantCursor: 0, wantPresent: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			url := "/events/topic"
+			if c.since != "" {
+				url += "?since=" + c.since
+			}
+			req := httptest.NewRequest(http.MethodGet, url, nil)
+			if c.lastEventID != "" {
+				req.Header.Set("Last-Event-ID", c.lastEventID)
+			}
+
+			cursor, present := cursorFromRequest(req)
+			if present != c.wantPresent {
+				t.Errorf("present = %v, want %v", present, c.wantPresent)
+			}
+			if cursor != c.wantCursor {
+				t.Errorf("cursor = %d, want %d", cursor, c.wantCursor)
+			}
+		})
+	}
+}
+
+func TestEventReplaySince(t *testing.T) {
+	r := newEventReplay()
+
+	for i := 0; i < 3; i++ {
+		r.append("topic-a", 10, nil)
+	}
+	r.append("topic-b", 10, nil)
+
+	cases := []struct {
+		name     string
+		topic    string
+		cursor   uint64
+		wantSeqs []uint64
+	}{
+		{name: "no cursor replays everything buffered", topic: "topic-a", cursor: 0, wantSeqs: []uint64{1, 2, 3}},
+		{name: "cursor skips already-seen events", topic: "topic-a", cursor: 2, wantSeqs: []uint64{3}},
+		{name: "cursor at head replays nothing", topic: "topic-a", cursor: 3, wantSeqs: nil},
+		{name: "unknown topic replays nothing", topic: "topic-c", cursor: 0, wantSeqs: nil},
+		{name: "other topics don't bleed into each other", topic: "topic-b", cursor: 0, wantSeqs: []uint64{4}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := r.since(c.topic, c.cursor)
+			if len(got) != len(c.wantSeqs) {
+				t.Fatalf("since(%q, %d) returned %d events, want %d", c.topic, c.cursor, len(got), len(c.wantSeqs))
+			}
+			for i, want := range c.wantSeqs {
+				if got[i].seq != want {
+					t.Errorf("event %d: seq = %d, want %d", i, got[i].seq, want)
+				}
+			}
+		})
+	}
+}
+
+func TestEventReplayBounded(t *testing.T) {
+	r := newEventReplay()
+	for i := 0; i < 5; i++ {
+		r.append("topic", 3, nil)
+	}
+
+	got := r.since("topic", 0)
+	if len(got) != 3 {
+		t.Fatalf("expected ring buffer capped at size 3, got %d events", len(got))
+	}
+	if got[0].seq != 3 || got[len(got)-1].seq != 5 {
+		t.Errorf("expected oldest-to-newest seqs 3..5, got %d..%d", got[0].seq, got[len(got)-1].seq)
+	}
+}
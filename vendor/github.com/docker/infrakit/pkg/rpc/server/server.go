@@ -1,13 +1,13 @@
 package server
 
 import (
+	"crypto/tls"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
-	"net/http/httptest"
-	"net/http/httputil"
 	"os"
+	"sync/atomic"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
@@ -19,6 +19,7 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/gorilla/rpc/v2"
 	"github.com/gorilla/rpc/v2/json2"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"gopkg.in/tylerb/graceful.v1"
 )
 
@@ -27,10 +28,24 @@ type Stoppable interface {
 	Stop()
 	AwaitStopped()
 	Wait() <-chan struct{}
+	// Reload hands the listening socket off to a freshly started copy of the running binary and drains this
+	// server's in-flight connections, so an upgrade can take over a TCP port or unix socket without dropping
+	// RPC calls or event subscribers.
+	Reload() error
 }
 
 type stoppableServer struct {
 	server *graceful.Server
+	// listener is what gracefulServer.Serve accepts connections on -- a tls.Listener when the server was
+	// started with StartListenerWithTLS.
+	listener net.Listener
+	// fdListener is the raw tcp/unix listener underneath listener, before any TLS wrapping. tls.Listener
+	// doesn't implement the File() method fd-passing needs, so Reload always hands off fdListener instead.
+	fdListener net.Listener
+	// reloaded is set once Reload hands the listening socket off to a successor process, so the goroutine
+	// draining this server's connections knows not to remove the discovery file out from under it -- the
+	// successor has already rewritten that file for itself.
+	reloaded int32
 }
 
 func (s *stoppableServer) Stop() {
@@ -45,33 +60,6 @@ func (s *stoppableServer) AwaitStopped() {
 	<-s.server.StopChan()
 }
 
-type loggingHandler struct {
-	handler http.Handler
-}
-
-func (h loggingHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	requestData, err := httputil.DumpRequest(req, true)
-	if err == nil {
-		log.Debugf("Received request %s", string(requestData))
-	} else {
-		log.Error(err)
-	}
-
-	recorder := httptest.NewRecorder()
-
-	h.handler.ServeHTTP(recorder, req)
-
-	responseData, err := httputil.DumpResponse(recorder.Result(), true)
-	if err == nil {
-		log.Debugf("Sending response %s", string(responseData))
-	} else {
-		log.Error(err)
-	}
-
-	w.WriteHeader(recorder.Code)
-	recorder.Body.WriteTo(w)
-}
-
 // A VersionedInterface identifies which Interfaces a plugin supports.
 type VersionedInterface interface {
 	// ImplementedInterface returns the interface being provided.
@@ -80,20 +68,39 @@ type VersionedInterface interface {
 	Types() []string
 }
 
+// ListenerOptions bundles the cross-cutting knobs accepted by StartListenerAtPath and StartListenerWithTLS,
+// so that adding one doesn't mean adding yet another positional parameter.
+type ListenerOptions struct {
+	// DisableMetrics skips registering the /metrics endpoint and its instrumentation, e.g. for plugins
+	// embedded in a process that already exposes its own Prometheus registry.
+	DisableMetrics bool
+	// Log configures the structured access log written for each RPC request.
+	Log LogOptions
+}
+
 // StartListenerAtPath starts an HTTP server listening on tcp port with discovery entry at specified path.
 // Returns a Stoppable that can be used to stop or block on the server.
-func StartListenerAtPath(listen []string, discoverPath string,
+func StartListenerAtPath(listen []string, discoverPath string, opt ListenerOptions,
 	receiver VersionedInterface, more ...VersionedInterface) (Stoppable, error) {
-	return startAtPath(listen, discoverPath, receiver, more...)
+	return startAtPath(listen, discoverPath, nil, opt, receiver, more...)
 }
 
 // StartPluginAtPath starts an HTTP server listening on a unix socket at the specified path.
 // Returns a Stoppable that can be used to stop or block on the server.
 func StartPluginAtPath(socketPath string, receiver VersionedInterface, more ...VersionedInterface) (Stoppable, error) {
-	return startAtPath(nil, socketPath, receiver, more...)
+	return startAtPath(nil, socketPath, nil, ListenerOptions{}, receiver, more...)
 }
 
-func startAtPath(listen []string, discoverPath string,
+// StartListenerWithTLS is the same as StartListenerAtPath except that the listener serves HTTPS, optionally
+// requiring and verifying client certificates (mTLS) when tlsConfig.CAFile is set. It is the secure counterpart
+// to the plain-HTTP StartListenerAtPath, which otherwise prevents plugins from talking to each other over a
+// trusted TCP channel.
+func StartListenerWithTLS(listen []string, discoverPath string, tlsConfig *TLSConfig, opt ListenerOptions,
+	receiver VersionedInterface, more ...VersionedInterface) (Stoppable, error) {
+	return startAtPath(listen, discoverPath, tlsConfig, opt, receiver, more...)
+}
+
+func startAtPath(listen []string, discoverPath string, tlsConfig *TLSConfig, opt ListenerOptions,
 	receiver VersionedInterface, more ...VersionedInterface) (Stoppable, error) {
 
 	server := rpc.NewServer()
@@ -104,20 +111,29 @@ func startAtPath(listen []string, discoverPath string,
 	interfaces := map[spi.InterfaceSpec][]string{}
 	for _, t := range targets {
 
-		interfaces[t.ImplementedInterface()] = t.Types()
+		interfaces[t.ImplementedInterface()] = handshakeTypes(t)
 
 		if err := server.RegisterService(t, ""); err != nil {
 			return nil, err
 		}
 	}
 
-	// handshake service that can exchange interface versions with client
+	// handshake service that can exchange interface versions with client. A VersionedStreamingInterface
+	// target's Types() is augmented by handshakeTypes with a "stream:<method>" entry per streaming method,
+	// so a client doing the handshake can tell which methods are dialable at urlStream up front instead of
+	// discovering it by trying and handling a 404.
 	if err := server.RegisterService(rpc_server.Handshake(interfaces), ""); err != nil {
 		return nil, err
 	}
 
+	var m *metrics
+	if !opt.DisableMetrics {
+		m = newMetrics()
+	}
+
 	// events handler
 	events := broker.NewBroker()
+	replay := newEventReplay()
 
 	// wire up the publish event source channel to the plugin implementations
 	for _, t := range targets {
@@ -127,6 +143,11 @@ func startAtPath(listen []string, discoverPath string,
 			continue
 		}
 
+		bufferSize := 0
+		if sizer, is := t.(EventBufferer); is {
+			bufferSize = sizer.EventBufferSize()
+		}
+
 		// We give one channel per source to provide some isolation.  This we won't have the
 		// whole event bus stop just because one plugin closes the channel.
 		eventChan := make(chan *event.Event)
@@ -137,6 +158,10 @@ func startAtPath(listen []string, discoverPath string,
 				if !ok {
 					return
 				}
+				if m != nil {
+					m.eventsTotal.WithLabelValues(event.Topic.String()).Inc()
+				}
+				replay.append(event.Topic.String(), bufferSize, event)
 				events.Publish(event.Topic.String(), event, 1*time.Second)
 			}
 		}()
@@ -160,44 +185,87 @@ func startAtPath(listen []string, discoverPath string,
 			for _, target := range targets {
 				if v, is := target.(event.Validator); is {
 					if err := v.Validate(types.PathFromString(topic)); err == nil {
+						if m != nil {
+							m.subscribers.WithLabelValues(topic).Inc()
+						}
 						return nil
 					}
 				}
 			}
 			return broker.ErrInvalidTopic(topic)
 		},
-		Do: events.ServeHTTP,
+		Do: func(w http.ResponseWriter, req *http.Request) {
+			topic := mux.Vars(req)["topic"]
+			// Only a reconnecting subscriber that actually sent a cursor gets a replay; a first-time
+			// subscriber has nothing to resume from and should just join the live stream.
+			if cursor, present := cursorFromRequest(req); present {
+				if buffered := replay.since(topic, cursor); len(buffered) > 0 {
+					writeReplay(w, topic, buffered)
+				}
+			}
+			events.ServeHTTP(w, req)
+		},
 		Post: func(topic string) {
+			if m != nil {
+				m.subscribers.WithLabelValues(topic).Dec()
+			}
 			log.Infoln("Client left", topic)
 		},
 	}
 	router.HandleFunc(rpc_server.URLEventsPrefix, intercept.ServeHTTP)
+	router.HandleFunc(urlStream, newStreamHandler(targets))
+
+	var rpcHandler http.Handler = server
+	if m != nil {
+		router.Handle(urlMetrics, promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+		rpcHandler = metricsHandler{handler: rpcHandler, metrics: m, registered: registeredMethods(targets)}
+	}
 
-	logger := loggingHandler{handler: server}
-	router.Handle("/", logger)
+	router.Handle("/", newAccessLogHandler(rpcHandler, opt.Log))
 
 	gracefulServer := graceful.Server{
 		Timeout: 10 * time.Second,
 	}
 
 	var listener net.Listener
+	// fdListener is listener's pre-TLS-wrap form, kept around so Reload can still pass its file descriptor
+	// to an upgraded process even when listener itself is a tls.Listener.
+	var fdListener net.Listener
+
+	var tc *tls.Config
+	if tlsConfig != nil {
+		config, err := newTLSConfig(tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+		tc = config
+	}
 
 	if len(listen) > 0 {
 		gracefulServer.Server = &http.Server{
-			Addr:    listen[0],
-			Handler: router,
+			Addr:      listen[0],
+			Handler:   router,
+			TLSConfig: tc,
 		}
-		l, err := net.Listen("tcp", listen[0])
+		l, err := inheritedOrListen("tcp", listen[0])
 		if err != nil {
 			return nil, err
 		}
+		fdListener = l
+		if tc != nil {
+			l = tls.NewListener(l, tc)
+		}
 		listener = l
 
 		advertise := listen[0]
 		if len(listen) > 1 {
 			advertise = listen[1]
 		}
-		if err := ioutil.WriteFile(discoverPath, []byte(fmt.Sprintf("tcp://%s", advertise)), 0644); err != nil {
+		scheme := "tcp"
+		if tc != nil {
+			scheme = "https"
+		}
+		if err := ioutil.WriteFile(discoverPath, []byte(fmt.Sprintf("%s://%s", scheme, advertise)), 0644); err != nil {
 			return nil, err
 		}
 
@@ -208,25 +276,31 @@ func startAtPath(listen []string, discoverPath string,
 			Addr:    fmt.Sprintf("unix://%s", discoverPath),
 			Handler: router,
 		}
-		l, err := net.Listen("unix", discoverPath)
+		l, err := inheritedOrListen("unix", discoverPath)
 		if err != nil {
 			return nil, err
 		}
 		listener = l
+		fdListener = l
 		log.Infof("Listening at: %s", discoverPath)
 
 	}
 
+	stoppable := &stoppableServer{server: &gracefulServer, listener: listener, fdListener: fdListener}
+
 	go func() {
 		err := gracefulServer.Serve(listener)
 		if err != nil {
 			log.Warn(err)
 		}
 		events.Stop()
-		if len(listen) > 0 {
+		// A Reload already rewrote discoverPath for the successor that took over the socket; removing it
+		// here once this drained process finally exits would make the plugin undiscoverable even though
+		// the successor is still listening.
+		if len(listen) > 0 && atomic.LoadInt32(&stoppable.reloaded) == 0 {
 			os.Remove(discoverPath)
 		}
 	}()
 
-	return &stoppableServer{server: &gracefulServer}, nil
+	return stoppable, nil
 }
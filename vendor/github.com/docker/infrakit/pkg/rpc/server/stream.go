@@ -0,0 +1,135 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+// Stream is a bidirectional channel between a streaming RPC handler and its caller, modeled on gRPC's
+// server-streaming and bidi-streaming semantics: either side may Send while the other Recv's, for as long
+// as the underlying connection stays open.
+type Stream interface {
+	// Send marshals and writes a single message to the other end of the stream.
+	Send(message interface{}) error
+	// Recv blocks until a message arrives from the other end, or returns an error when the stream ends.
+	Recv(message interface{}) error
+}
+
+// StreamHandler implements one streaming RPC method. It is handed the initial request and a Stream for
+// exchanging further messages with the caller until either side closes the connection.
+type StreamHandler func(request json.RawMessage, stream Stream) error
+
+// VersionedStreamingInterface is implemented by plugins that, in addition to their unary VersionedInterface,
+// expose one or more streaming RPC methods, e.g. to report incremental progress on a long-running operation
+// such as droplet provisioning or an instance-group roll.
+type VersionedStreamingInterface interface {
+	VersionedInterface
+
+	// StreamMethods returns the streaming methods this plugin exposes, keyed by method name.
+	StreamMethods() map[string]StreamHandler
+}
+
+// urlStream is the route pattern for the streaming RPC endpoint, analogous to rpc_server.URLEventsPrefix
+// for the event broker.
+const urlStream = "/stream/{service}/{method}"
+
+// encodeStreamService turns a VersionedInterface's ImplementedInterface() into a single mux path segment
+// safe to embed in urlStream. ImplementedInterface() formats as Name/Version-shaped data, so embedding it
+// raw would split across what {service} expects to be one segment (and do worse on spaces or other
+// characters); base64 URL encoding sidesteps both since its alphabet never contains "/" and needs no
+// escaping. The client encodes the same way when it builds the dial URL, so both sides agree on the token
+// without either having to escape/unescape path segments.
+func encodeStreamService(service string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(service))
+}
+
+// streamTypePrefix marks a synthetic entry handshakeTypes adds to a target's reported Types(), naming a
+// streaming method rather than one of the target's usual object types.
+const streamTypePrefix = "stream:"
+
+// handshakeTypes returns the Types() to report for t during the handshake, augmented with one
+// "stream:<method>" entry per streaming method when t also implements VersionedStreamingInterface. This is
+// what lets a client tell, from the handshake alone, which methods it can dial at urlStream instead of
+// discovering it by trying and handling a 404.
+func handshakeTypes(t VersionedInterface) []string {
+	types := append([]string{}, t.Types()...)
+
+	streaming, is := t.(VersionedStreamingInterface)
+	if !is {
+		return types
+	}
+	for method := range streaming.StreamMethods() {
+		types = append(types, streamTypePrefix+method)
+	}
+	return types
+}
+
+var streamUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+	// Plugin RPC is typically consumed by local CLI tools and other plugins rather than browsers, so there's
+	// no same-origin policy to enforce here.
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+type wsStream struct {
+	conn *websocket.Conn
+}
+
+func (s *wsStream) Send(message interface{}) error {
+	return s.conn.WriteJSON(message)
+}
+
+func (s *wsStream) Recv(message interface{}) error {
+	return s.conn.ReadJSON(message)
+}
+
+// newStreamHandler builds the handler for urlStream, dispatching to the StreamHandler registered by
+// whichever target's ImplementedInterface matches the {service} path variable.
+func newStreamHandler(targets []VersionedInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		vars := mux.Vars(req)
+		service, method := vars["service"], vars["method"]
+
+		var handler StreamHandler
+		for _, t := range targets {
+			streaming, is := t.(VersionedStreamingInterface)
+			if !is {
+				continue
+			}
+			if encodeStreamService(fmt.Sprintf("%v", streaming.ImplementedInterface())) != service {
+				continue
+			}
+			handler = streaming.StreamMethods()[method]
+			break
+		}
+
+		if handler == nil {
+			http.NotFound(w, req)
+			return
+		}
+
+		conn, err := streamUpgrader.Upgrade(w, req, nil)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+		defer conn.Close()
+
+		var request json.RawMessage
+		if err := conn.ReadJSON(&request); err != nil {
+			log.Error(err)
+			return
+		}
+
+		if err := handler(request, &wsStream{conn: conn}); err != nil {
+			log.Error(err)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEncodeStreamService(t *testing.T) {
+	cases := []struct {
+		name    string
+		service string
+	}{
+		{name: "name/version shaped spec", service: "Instance/0.6.0"},
+		{name: "contains a space", service: "My Plugin/1.0"},
+		{name: "empty", service: ""},
+	}
+
+	seen := map[string]bool{}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			token := encodeStreamService(c.service)
+
+			if strings.ContainsAny(token, "/ ") {
+				t.Errorf("encodeStreamService(%q) = %q, contains a character unsafe for a single mux path segment", c.service, token)
+			}
+			if seen[token] {
+				t.Errorf("encodeStreamService(%q) collided with a previous case's token", c.service)
+			}
+			seen[token] = true
+
+			if token != encodeStreamService(c.service) {
+				t.Errorf("encodeStreamService(%q) is not deterministic", c.service)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+// TLSConfig carries the parameters needed to serve the plugin listener over HTTPS, and, when CAFile is set,
+// to require and verify client certificates (mTLS) for every incoming connection.
+type TLSConfig struct {
+	// CertFile is the path to the PEM-encoded certificate presented to clients.
+	CertFile string
+	// KeyFile is the path to the PEM-encoded private key matching CertFile.
+	KeyFile string
+	// CAFile, when set, is a PEM-encoded bundle of CAs used to verify client certificates. Setting it
+	// switches the listener into requiring a client certificate on every connection.
+	CAFile string
+	// MinVersion is the minimum TLS version to accept, e.g. tls.VersionTLS12. Zero uses the crypto/tls default.
+	MinVersion uint16
+	// CipherSuites restricts the cipher suites the listener will negotiate. Nil uses the crypto/tls default list.
+	CipherSuites []uint16
+}
+
+// newTLSConfig builds a *tls.Config from a TLSConfig, loading the server certificate and, if CAFile is set,
+// the client CA bundle used for mutual TLS authentication.
+func newTLSConfig(config *TLSConfig) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   config.MinVersion,
+		CipherSuites: config.CipherSuites,
+	}
+
+	if config.CAFile != "" {
+		pem, err := ioutil.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", config.CAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestNewTLSConfigLoadsCertificate(t *testing.T) {
+	certFile, keyFile, cleanup := writeTestCertPair(t)
+	defer cleanup()
+
+	config, err := newTLSConfig(&TLSConfig{CertFile: certFile, KeyFile: keyFile, MinVersion: tls.VersionTLS12})
+	if err != nil {
+		t.Fatalf("newTLSConfig: %v", err)
+	}
+	if len(config.Certificates) != 1 {
+		t.Fatalf("expected one loaded certificate, got %d", len(config.Certificates))
+	}
+	if config.MinVersion != tls.VersionTLS12 {
+		t.Errorf("MinVersion = %d, want %d", config.MinVersion, tls.VersionTLS12)
+	}
+	if config.ClientAuth != tls.NoClientCert {
+		t.Errorf("ClientAuth = %v, want NoClientCert when CAFile is unset", config.ClientAuth)
+	}
+}
+
+func TestNewTLSConfigWithCABundle(t *testing.T) {
+	certFile, keyFile, cleanup := writeTestCertPair(t)
+	defer cleanup()
+
+	config, err := newTLSConfig(&TLSConfig{CertFile: certFile, KeyFile: keyFile, CAFile: certFile})
+	if err != nil {
+		t.Fatalf("newTLSConfig: %v", err)
+	}
+	if config.ClientAuth != tls.RequireAndVerifyClientCert {
+		t.Errorf("ClientAuth = %v, want RequireAndVerifyClientCert when CAFile is set", config.ClientAuth)
+	}
+	if config.ClientCAs == nil {
+		t.Error("expected ClientCAs to be populated from CAFile")
+	}
+}
+
+func TestNewTLSConfigBadCertFile(t *testing.T) {
+	if _, err := newTLSConfig(&TLSConfig{CertFile: "/no/such/cert.pem", KeyFile: "/no/such/key.pem"}); err == nil {
+		t.Error("expected an error for a missing certificate file")
+	}
+}
+
+// writeTestCertPair generates a throwaway self-signed certificate and key, writes them to a temp dir as PEM
+// files, and returns their paths and a cleanup func -- so these tests don't depend on fixtures checked into
+// the repo or external tooling like openssl.
+func writeTestCertPair(t *testing.T) (certFile, keyFile string, cleanup func()) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{Organization: []string{"infrakit test"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "infrakit-tls-test")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+
+	certFile = dir + "/cert.pem"
+	keyFile = dir + "/key.pem"
+
+	certOut, err := os.Create(certFile)
+	if err != nil {
+		t.Fatalf("create cert file: %v", err)
+	}
+	if err := pem.Encode(certOut, &pem.Block{Type: "CERTIFICATE", Bytes: der}); err != nil {
+		t.Fatalf("encode cert: %v", err)
+	}
+	certOut.Close()
+
+	keyOut, err := os.Create(keyFile)
+	if err != nil {
+		t.Fatalf("create key file: %v", err)
+	}
+	if err := pem.Encode(keyOut, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}); err != nil {
+		t.Fatalf("encode key: %v", err)
+	}
+	keyOut.Close()
+
+	return certFile, keyFile, func() { os.RemoveAll(dir) }
+}